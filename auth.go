@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// principal identifies the tenant and subject a request has been authenticated as.
+type principal struct {
+	Tenant  string
+	Subject string
+}
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// tokenPrincipals maps bearer API tokens to the principal they authenticate as.
+// Populated at startup from the -auth-tokens flag.
+var tokenPrincipals = map[string]principal{}
+
+// loadTokens parses a comma-separated list of "token:tenant:subject" entries
+// (as produced by the -auth-tokens flag) into tokenPrincipals.
+func loadTokens(raw string) {
+	tokenPrincipals = map[string]principal{}
+	if raw == "" {
+		return
+	}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			log.Printf("Skipping malformed -auth-tokens entry: %q", entry)
+			continue
+		}
+		tokenPrincipals[parts[0]] = principal{Tenant: parts[1], Subject: parts[2]}
+	}
+	log.Printf("Loaded %d API token(s)", len(tokenPrincipals))
+}
+
+// withAuth wraps an HTTP handler so that it only runs for requests bearing a
+// valid "Authorization: Bearer <token>" header, and makes the resolved
+// principal available to the handler via the request context.
+func withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if token == "" || token == authHeader {
+			http.Error(w, "Missing or malformed Authorization header", http.StatusUnauthorized)
+			return
+		}
+
+		p, ok := tokenPrincipals[token]
+		if !ok {
+			http.Error(w, "Invalid API token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey, p)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// principalFromContext extracts the authenticated principal set by withAuth.
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalContextKey).(principal)
+	return p, ok
+}
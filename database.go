@@ -1,103 +1,153 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"sort"
-
-	"github.com/unit-io/unitdb"
+	"time"
 )
 
-var db *unitdb.DB
-
-// InitDB initializes the unitdb database connection.
-func InitDB(dbPath string) error {
-	var err error
-	// Open DB with Mutable flag to allow potential future delete operations if needed,
-	// though the current spec doesn't require deletes.
-	db, err = unitdb.Open(dbPath, unitdb.WithDefaultOptions(), unitdb.WithMutable())
-	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+// storeIsExternal records whether the active store is external, independently
+// writable by other processes, and already able to push range filtering down to
+// the backend itself (currently true only for -store=influxdb). Reads against
+// such a store go straight to it on every call instead of through a locationIndex:
+// caching its entire decoded history in process memory would just add unbounded
+// RAM growth and staleness (another process's writes would never be seen) without
+// saving any real work, since Influx already answers ReadLocationDataRange with a
+// server-side range query rather than a full scan.
+var storeIsExternal bool
+
+// InitDB initializes the configured storage backend. storeKind selects between
+// "unitdb" (the default) and "influxdb"; the influx* arguments are only used
+// when storeKind is "influxdb".
+func InitDB(storeKind, dbPath, influxURL, influxToken, influxOrg, influxBucket string) error {
+	switch storeKind {
+	case "", "unitdb":
+		s, err := newUnitdbStore(dbPath)
+		if err != nil {
+			return err
+		}
+		activeStore = s
+		storeIsExternal = false
+	case "influxdb":
+		s, err := newInfluxStore(influxURL, influxToken, influxOrg, influxBucket)
+		if err != nil {
+			return err
+		}
+		activeStore = s
+		storeIsExternal = true
+	default:
+		return fmt.Errorf("unknown -store value %q (expected \"unitdb\" or \"influxdb\")", storeKind)
 	}
-	log.Println("Database opened successfully at", dbPath)
 	return nil
 }
 
-// CloseDB closes the database connection.
+// CloseDB closes the active storage backend.
 func CloseDB() {
-	if db != nil {
-		db.Close()
-		log.Println("Database closed.")
+	if activeStore == nil {
+		return
+	}
+	if err := activeStore.Close(); err != nil {
+		log.Printf("Error closing store: %v", err)
 	}
 }
 
-// GetTopicForUser formats the database topic string for a given user ID.
-func GetTopicForUser(userID string) []byte {
-	return []byte(fmt.Sprintf("user.%s.location", userID))
-}
-
-// WriteLocationData writes a batch of location data points for a specific user.
-func WriteLocationData(userID string, dataPoints []LocationData) error {
-	if db == nil {
+// WriteLocationData writes a batch of location data points for a specific tenant/user
+// through the active store, mirrors the batch to any registered subscriptions, and
+// folds it into the user's in-memory timestamp index.
+func WriteLocationData(tenant, userID string, dataPoints []LocationData) error {
+	if activeStore == nil {
 		return fmt.Errorf("database not initialized")
 	}
-	topic := GetTopicForUser(userID)
-
-	return db.Batch(func(b *unitdb.Batch, completed <-chan struct{}) error {
-		entry := unitdb.NewEntry(topic, nil)
-		for _, data := range dataPoints {
-			payload, err := json.Marshal(data)
-			if err != nil {
-				log.Printf("Error marshalling location data for user %s: %v", userID, err)
-				continue
-			}
-			// Using WithPayload reuses the parsed topic, improving efficiency
-			entry.WithPayload(payload)
-			if err := b.PutEntry(entry); err != nil {
-				log.Printf("Error putting entry in batch for user %s: %v", userID, err)
-			}
-		}
-		return nil // Signal batch completion attempt
-	})
+
+	writeStart := time.Now()
+	err := activeStore.WriteLocationData(tenant, userID, dataPoints)
+	recordWrite(tenant, userID, len(dataPoints), time.Since(writeStart), err)
+	if err != nil {
+		return err
+	}
+
+	// Mirror the batch to any subscriptions registered for this tenant.
+	fanOutBatch(tenant, userID, dataPoints)
+
+	// Keep the timestamp index in sync so range queries don't need to rescan the
+	// store. Not applicable when the store is external: those reads bypass the
+	// index entirely (see storeIsExternal), so there's nothing to keep in sync.
+	if !storeIsExternal {
+		getIndex(tenant, userID).append(dataPoints)
+	}
+
+	return nil
 }
 
-// ReadLocationData retrieves location data for a specific user, with optional percentage-based slicing.
-// minPercent and maxPercent range from 0.0 to 1.0.
-func ReadLocationData(userID string, minPercent, maxPercent float64) ([]LocationData, error) {
-	if db == nil {
+// readAllLocationData pulls every point for a tenant/user timestamped up to the
+// current time from the active store, sorted oldest to newest; points with a later
+// timestamp are not returned. It exists to (re)build a locationIndex and should not be
+// called on the hot read path directly.
+func readAllLocationData(tenant, userID string) ([]LocationData, error) {
+	if activeStore == nil {
 		return nil, fmt.Errorf("database not initialized")
 	}
-	topic := GetTopicForUser(userID)
-	query := unitdb.NewQuery(topic)
+	return activeStore.ReadLocationDataRange(tenant, userID, time.Time{}, time.Now())
+}
 
-	rawMessages, err := db.Get(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get data for user %s from DB: %w", userID, err)
+// ReadLocationDataRange returns every point for tenant/userID with a timestamp in
+// [start, end]. When the store is external, the range is queried from it directly;
+// otherwise it's served from the user's timestamp index (rebuilt from the store on
+// first access). See storeIsExternal.
+func ReadLocationDataRange(tenant, userID string, start, end time.Time) ([]LocationData, error) {
+	if storeIsExternal {
+		return activeStore.ReadLocationDataRange(tenant, userID, start, end)
 	}
-
-	if len(rawMessages) == 0 {
-		return []LocationData{}, nil
+	idx := getIndex(tenant, userID)
+	if err := idx.ensureLoaded(tenant, userID); err != nil {
+		return nil, err
 	}
+	return idx.rangeQuery(start, end), nil
+}
 
-	locationDataList := make([]LocationData, 0, len(rawMessages))
-	for _, rawMsg := range rawMessages {
-		var data LocationData
-		if err := json.Unmarshal(rawMsg, &data); err != nil {
-			log.Printf("Error unmarshalling data for user %s: %v. Data: %s", userID, err, string(rawMsg))
-			continue // Skip corrupted data
+// UserStats returns the count, time bounds, and approximate stored bytes for
+// tenant/userID, served from the timestamp index when the store is local, or
+// computed directly against the store when it's external (see storeIsExternal).
+func UserStats(tenant, userID string) (count int, first, last time.Time, bytes int64, err error) {
+	if storeIsExternal {
+		data, rerr := activeStore.ReadLocationDataRange(tenant, userID, time.Time{}, time.Now())
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		count = len(data)
+		if count > 0 {
+			first = data[0].Timestamp
+			last = data[count-1].Timestamp
 		}
-		locationDataList = append(locationDataList, data)
+		bytes = approximateBytes(data)
+		return
+	}
+
+	idx := getIndex(tenant, userID)
+	if err = idx.ensureLoaded(tenant, userID); err != nil {
+		return
 	}
+	count, first, last, bytes = idx.stats()
+	return
+}
 
-	// Sort data by timestamp (oldest to newest)
-	sort.Slice(locationDataList, func(i, j int) bool {
-		return locationDataList[i].Timestamp.Before(locationDataList[j].Timestamp)
-	})
+// UserTimeBounds returns the first and last timestamp on record for tenant/userID, plus
+// the total point count, so callers can resolve percentage-based ranges into absolute times.
+func UserTimeBounds(tenant, userID string) (first, last time.Time, count int, err error) {
+	count, first, last, _, err = UserStats(tenant, userID)
+	return
+}
 
-	// Apply percentage-based slicing
-	totalEntries := len(locationDataList)
-	if totalEntries == 0 {
+// ReadLocationData is a compatibility shim for the old percentage-based API: it resolves
+// minPercent/maxPercent against the user's recorded time bounds and delegates to
+// ReadLocationDataRange. minPercent and maxPercent range from 0.0 to 1.0.
+func ReadLocationData(tenant, userID string, minPercent, maxPercent float64) ([]LocationData, error) {
+	first, last, count, err := UserTimeBounds(tenant, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
 		return []LocationData{}, nil
 	}
 
@@ -112,19 +162,9 @@ func ReadLocationData(userID string, minPercent, maxPercent float64) ([]Location
 		minPercent = maxPercent // Or handle as an error, for now, clamp
 	}
 
-	startIndex := int(minPercent * float64(totalEntries))
-	endIndex := int(maxPercent * float64(totalEntries))
-
-	// Ensure indices are within bounds
-	if startIndex < 0 {
-		startIndex = 0
-	}
-	if endIndex > totalEntries {
-		endIndex = totalEntries
-	}
-	if startIndex > endIndex {
-		startIndex = endIndex
-	}
+	span := last.Sub(first)
+	start := first.Add(time.Duration(minPercent * float64(span)))
+	end := first.Add(time.Duration(maxPercent * float64(span)))
 
-	return locationDataList[startIndex:endIndex], nil
+	return ReadLocationDataRange(tenant, userID, start, end)
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,11 +19,14 @@ type simulationControl struct {
 	// We might add more per-user control state here later if needed
 }
 
+// logQueries enables structured logging of every /user read, set via the -log-queries flag.
+var logQueries bool
+
 var (
-	activeSimulations      = make(map[string]*simulationControl)
+	// activeSimulations tracks in-flight simulations per tenant, so /stop only
+	// ever cancels the runs started by the caller's own tenant.
+	activeSimulations      = make(map[string]map[string]*simulationControl)
 	activeSimulationsMutex sync.Mutex
-	currentSimulationCtx   context.Context
-	currentUsers           []string
 )
 
 const simulationDuration = 30 * time.Second
@@ -33,7 +37,11 @@ func handleStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stopSimulationsInternal()
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
+		return
+	}
 
 	var req StartRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -46,30 +54,46 @@ func handleStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Received /start request for %d users", len(req.UserIDs))
+	// Construct the model once up front, purely to validate req.Model/req.Params
+	// synchronously: newMovementModel errors (bad model name, a waypoint model with
+	// no waypoints or non-positive speed, a missing replay file, ...) would otherwise
+	// only surface as a log line inside the per-user goroutine below, leaving the
+	// caller with a false "200 started" response and no running simulations.
+	if _, err := newMovementModel(req.Model, req.Params); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid model configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	stopSimulationsForTenant(p.Tenant)
+
+	log.Printf("Received /start request for tenant %s, %d users", p.Tenant, len(req.UserIDs))
 
-	activeSimulationsMutex.Lock()
 	// Create a new parent context for this run with a timeout
-	currentSimulationCtx, _ = context.WithTimeout(context.Background(), simulationDuration)
-	currentUsers = make([]string, len(req.UserIDs))
-	copy(currentUsers, req.UserIDs)
+	simulationCtx, _ := context.WithTimeout(context.Background(), simulationDuration)
 
+	activeSimulationsMutex.Lock()
+	tenantSimulations := activeSimulations[p.Tenant]
+	if tenantSimulations == nil {
+		tenantSimulations = make(map[string]*simulationControl)
+		activeSimulations[p.Tenant] = tenantSimulations
+	}
 	for _, userID := range req.UserIDs {
 		if userID == "" {
 			log.Println("Skipping empty user ID in start request")
 			continue
 		}
-		userCtx, cancel := context.WithCancel(currentSimulationCtx)
-		activeSimulations[userID] = &simulationControl{cancelFunc: cancel}
-		go SimulateUserMovement(userCtx, userID)
+		userCtx, cancel := context.WithCancel(simulationCtx)
+		tenantSimulations[userID] = &simulationControl{cancelFunc: cancel}
+		go SimulateUserMovement(userCtx, p.Tenant, userID, req.Model, req.Params)
 	}
 	activeSimulationsMutex.Unlock()
+	updateActiveSimulationsGauge()
 
 	go func() {
-		<-currentSimulationCtx.Done()
-		if currentSimulationCtx.Err() == context.DeadlineExceeded {
-			log.Printf("Simulation duration (%s) reached, stopping automatically.", simulationDuration)
-			stopSimulationsInternal() // Ensure cleanup if timeout hits
+		<-simulationCtx.Done()
+		if simulationCtx.Err() == context.DeadlineExceeded {
+			log.Printf("Simulation duration (%s) reached for tenant %s, stopping automatically.", simulationDuration, p.Tenant)
+			stopSimulationsForTenant(p.Tenant) // Ensure cleanup if timeout hits
 		}
 	}()
 
@@ -77,25 +101,58 @@ func handleStart(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Simulation started for %d users. Will run for approximately %s.\n", len(req.UserIDs), simulationDuration)
 }
 
-// stopSimulationsInternal stops all active simulations. Assumes mutex is handled by caller or not needed.
-func stopSimulationsInternal() {
+// stopSimulationsForTenant stops all active simulations belonging to the given tenant.
+func stopSimulationsForTenant(tenant string) {
 	activeSimulationsMutex.Lock()
-	defer activeSimulationsMutex.Unlock()
-
-	if len(activeSimulations) == 0 {
-		log.Println("Stop request received, but no simulations are currently active.")
+	tenantSimulations := activeSimulations[tenant]
+	if len(tenantSimulations) == 0 {
+		activeSimulationsMutex.Unlock()
+		log.Printf("Stop request received for tenant %s, but no simulations are currently active.", tenant)
 		return
 	}
 
-	log.Printf("Stopping %d active simulations...", len(activeSimulations))
-	for userID, control := range activeSimulations {
+	log.Printf("Stopping %d active simulation(s) for tenant %s...", len(tenantSimulations), tenant)
+	for userID, control := range tenantSimulations {
 		control.cancelFunc() // Signal the goroutine to stop
-		delete(activeSimulations, userID)
+		delete(tenantSimulations, userID)
+	}
+	delete(activeSimulations, tenant)
+	activeSimulationsMutex.Unlock()
+
+	log.Printf("All simulations stopped for tenant %s.", tenant)
+	updateActiveSimulationsGauge()
+}
+
+// deregisterSimulation removes a single user's entry from activeSimulations once its
+// goroutine has exited on its own, because the movement model reported it has
+// nothing left to emit. /stop and the simulation timeout clean up via
+// stopSimulationsForTenant instead; this is the natural-completion path, which
+// would otherwise leave a stale entry (and an orphaned cancelFunc) behind until
+// the tenant's next /start or /stop.
+func deregisterSimulation(tenant, userID string) {
+	activeSimulationsMutex.Lock()
+	if tenantSimulations, ok := activeSimulations[tenant]; ok {
+		delete(tenantSimulations, userID)
+		if len(tenantSimulations) == 0 {
+			delete(activeSimulations, tenant)
+		}
+	}
+	activeSimulationsMutex.Unlock()
+	updateActiveSimulationsGauge()
+}
+
+// stopSimulationsInternal stops every active simulation across all tenants. Used on shutdown.
+func stopSimulationsInternal() {
+	activeSimulationsMutex.Lock()
+	tenants := make([]string, 0, len(activeSimulations))
+	for tenant := range activeSimulations {
+		tenants = append(tenants, tenant)
 	}
-	currentUsers = nil
-	if currentSimulationCtx != nil {
+	activeSimulationsMutex.Unlock()
+
+	for _, tenant := range tenants {
+		stopSimulationsForTenant(tenant)
 	}
-	log.Println("All simulations stopped.")
 }
 
 func handleStop(w http.ResponseWriter, r *http.Request) {
@@ -104,63 +161,97 @@ func handleStop(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stopSimulationsInternal()
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
+		return
+	}
+
+	stopSimulationsForTenant(p.Tenant)
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "All active simulations stopped.")
 }
 
-func handleGetUser(w http.ResponseWriter, r *http.Request) {
+// handleUserRoute dispatches GET /user/{user_id} and GET /user/{user_id}/stats.
+func handleUserRoute(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Expecting path like /user/{user_id}
 	pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
-	if len(pathParts) != 2 || pathParts[0] != "user" || pathParts[1] == "" {
+	if len(pathParts) < 2 || pathParts[0] != "user" || pathParts[1] == "" {
 		http.Error(w, "Invalid URL path. Expected /user/{user_id}", http.StatusBadRequest)
 		return
 	}
 	userID := pathParts[1]
 
-	// Parse min and max query parameters
-	minPercentStr := r.URL.Query().Get("min")
-	maxPercentStr := r.URL.Query().Get("max")
-
-	minPercent := 0.0
-	maxPercent := 1.0
-	var err error
-
-	if minPercentStr != "" {
-		minPercent, err = strconv.ParseFloat(minPercentStr, 64)
-		if err != nil || minPercent < 0.0 || minPercent > 1.0 {
-			http.Error(w, "Invalid 'min' parameter. Must be a float between 0.0 and 1.0.", http.StatusBadRequest)
+	switch len(pathParts) {
+	case 2:
+		handleGetUser(w, r, userID)
+	case 3:
+		if pathParts[2] != "stats" {
+			http.Error(w, "Invalid URL path. Expected /user/{user_id}/stats", http.StatusBadRequest)
 			return
 		}
+		handleUserStats(w, r, userID)
+	default:
+		http.Error(w, "Invalid URL path.", http.StatusBadRequest)
 	}
+}
 
-	if maxPercentStr != "" {
-		maxPercent, err = strconv.ParseFloat(maxPercentStr, 64)
-		if err != nil || maxPercent < 0.0 || maxPercent > 1.0 {
-			http.Error(w, "Invalid 'max' parameter. Must be a float between 0.0 and 1.0.", http.StatusBadRequest)
-			return
-		}
-	}
+// handleGetUser serves GET /user/{user_id}, accepting either an RFC3339 start/end
+// time range or the legacy min/max percentage range (resolved against the user's
+// recorded time bounds).
+func handleGetUser(w http.ResponseWriter, r *http.Request, userID string) {
+	requestStart := time.Now()
 
-	if minPercent > maxPercent {
-		http.Error(w, "'min' parameter cannot be greater than 'max' parameter.", http.StatusBadRequest)
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
 		return
 	}
 
-	log.Printf("GET /user/%s request with min=%.2f, max=%.2f", userID, minPercent, maxPercent)
+	query := r.URL.Query()
+	startStr := query.Get("start")
+	endStr := query.Get("end")
+
+	var (
+		userData []LocationData
+		err      error
+		logRange string
+	)
+
+	if startStr != "" || endStr != "" {
+		rangeStart, rangeEnd, parseErr := parseTimeRange(startStr, endStr)
+		if parseErr != nil {
+			http.Error(w, fmt.Sprintf("Invalid 'start'/'end' parameter: %v", parseErr), http.StatusBadRequest)
+			return
+		}
+		userData, err = ReadLocationDataRange(p.Tenant, userID, rangeStart, rangeEnd)
+		logRange = fmt.Sprintf("start=%s end=%s", rangeStart.Format(time.RFC3339), rangeEnd.Format(time.RFC3339))
+	} else {
+		minPercent, maxPercent, parseErr := parsePercentRange(query)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		userData, err = ReadLocationData(p.Tenant, userID, minPercent, maxPercent)
+		logRange = fmt.Sprintf("min=%.2f max=%.2f", minPercent, maxPercent)
+	}
 
-	userData, err := ReadLocationData(userID, minPercent, maxPercent)
 	if err != nil {
-		log.Printf("Error reading data for user %s: %v", userID, err)
+		log.Printf("Error reading data for tenant %s user %s: %v", p.Tenant, userID, err)
 		http.Error(w, fmt.Sprintf("Failed to retrieve data for user %s: %v", userID, err), http.StatusInternalServerError)
 		return
 	}
 
+	log.Printf("GET /user/%s request for tenant %s with %s", userID, p.Tenant, logRange)
+	recordRead(len(userData))
+	if logQueries {
+		log.Printf("query tenant=%s user=%s %s rows=%d elapsed=%s", p.Tenant, userID, logRange, len(userData), time.Since(requestStart))
+	}
+
 	if len(userData) == 0 {
 		// Check if the original range might have filtered out all data, or if user truly has no data
 		// For simplicity, we'll return Not Found. A more sophisticated check could query without percentages first.
@@ -180,3 +271,90 @@ func handleGetUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+// parseTimeRange parses the optional RFC3339 start/end query parameters, defaulting
+// to the zero time and time.Now() respectively when omitted.
+func parseTimeRange(startStr, endStr string) (start, end time.Time, err error) {
+	end = time.Now()
+	if startStr != "" {
+		start, err = time.Parse(time.RFC3339, startStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("'start' must be RFC3339: %w", err)
+		}
+	}
+	if endStr != "" {
+		end, err = time.Parse(time.RFC3339, endStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("'end' must be RFC3339: %w", err)
+		}
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("'start' cannot be after 'end'")
+	}
+	return start, end, nil
+}
+
+// parsePercentRange parses the legacy min/max percentage query parameters.
+func parsePercentRange(query url.Values) (minPercent, maxPercent float64, err error) {
+	minPercent, maxPercent = 0.0, 1.0
+
+	if minStr := query.Get("min"); minStr != "" {
+		minPercent, err = strconv.ParseFloat(minStr, 64)
+		if err != nil || minPercent < 0.0 || minPercent > 1.0 {
+			return 0, 0, fmt.Errorf("invalid 'min' parameter. Must be a float between 0.0 and 1.0")
+		}
+	}
+
+	if maxStr := query.Get("max"); maxStr != "" {
+		maxPercent, err = strconv.ParseFloat(maxStr, 64)
+		if err != nil || maxPercent < 0.0 || maxPercent > 1.0 {
+			return 0, 0, fmt.Errorf("invalid 'max' parameter. Must be a float between 0.0 and 1.0")
+		}
+	}
+
+	if minPercent > maxPercent {
+		return 0, 0, fmt.Errorf("'min' parameter cannot be greater than 'max' parameter")
+	}
+
+	return minPercent, maxPercent, nil
+}
+
+// UserStatsResponse is the JSON body returned by GET /user/{user_id}/stats.
+type UserStatsResponse struct {
+	UserID         string    `json:"user_id"`
+	Count          int       `json:"count"`
+	FirstTimestamp time.Time `json:"first_timestamp,omitempty"`
+	LastTimestamp  time.Time `json:"last_timestamp,omitempty"`
+	ApproxBytes    int64     `json:"approx_bytes"`
+}
+
+// handleUserStats serves GET /user/{user_id}/stats.
+func handleUserStats(w http.ResponseWriter, r *http.Request, userID string) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
+		return
+	}
+
+	count, first, last, bytes, err := UserStats(p.Tenant, userID)
+	if err != nil {
+		log.Printf("Error computing stats for tenant %s user %s: %v", p.Tenant, userID, err)
+		http.Error(w, fmt.Sprintf("Failed to retrieve stats for user %s: %v", userID, err), http.StatusInternalServerError)
+		return
+	}
+
+	response := UserStatsResponse{
+		UserID:         userID,
+		Count:          count,
+		FirstTimestamp: first,
+		LastTimestamp:  last,
+		ApproxBytes:    bytes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding /user/%s/stats response: %v", userID, err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
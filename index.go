@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// indexKey identifies the per-tenant, per-user timestamp index.
+type indexKey struct {
+	Tenant string
+	UserID string
+}
+
+// maxCachedIndexes bounds how many users' indexes may be cached in process memory
+// at once. getIndex is only ever called for the embedded (unitdb) store these days
+// (see storeIsExternal and database.go) — an external store is queried directly,
+// with nothing cached — but a long-running simulator against unitdb can still see
+// far more distinct tenant/user pairs than fit comfortably in RAM, so the cache
+// needs a ceiling of its own rather than growing forever. runIndexCompaction
+// evicts the least-recently-used entries back down to this cap on every pass.
+const maxCachedIndexes = 2000
+
+// locationIndex is an in-memory, timestamp-sorted index over a single user's
+// location data, used to serve time-range queries without rescanning and
+// re-decoding every message on every read. It is lazily rebuilt from the active
+// store the first time a user is queried.
+type locationIndex struct {
+	mu         sync.RWMutex
+	entries    []LocationData // sorted ascending by Timestamp
+	bytes      int64          // approximate JSON-encoded bytes represented by entries
+	loaded     bool
+	lastAccess time.Time // updated on every load/read, used for LRU eviction
+}
+
+var (
+	indexes      = make(map[indexKey]*locationIndex)
+	indexesMutex sync.Mutex
+)
+
+// getIndex returns the (possibly empty, not-yet-loaded) index for tenant/userID,
+// creating it if this is the first time the pair has been seen.
+func getIndex(tenant, userID string) *locationIndex {
+	key := indexKey{Tenant: tenant, UserID: userID}
+
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	idx, ok := indexes[key]
+	if !ok {
+		idx = &locationIndex{}
+		indexes[key] = idx
+	}
+	return idx
+}
+
+// ensureLoaded rebuilds the index from the active store on first access for this user.
+func (idx *locationIndex) ensureLoaded(tenant, userID string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.lastAccess = time.Now()
+	if idx.loaded {
+		return nil
+	}
+
+	data, err := readAllLocationData(tenant, userID)
+	if err != nil {
+		return err
+	}
+
+	idx.entries = data
+	idx.bytes = approximateBytes(data)
+	idx.loaded = true
+	return nil
+}
+
+// append folds newly written points into the index, keeping it sorted by timestamp.
+func (idx *locationIndex) append(points []LocationData) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.loaded {
+		// The next read will rebuild from unitdb and pick these points up then.
+		return
+	}
+
+	idx.entries = append(idx.entries, points...)
+	sort.Slice(idx.entries, func(i, j int) bool {
+		return idx.entries[i].Timestamp.Before(idx.entries[j].Timestamp)
+	})
+	idx.bytes += approximateBytes(points)
+}
+
+// rangeQuery returns every entry with start <= Timestamp <= end.
+func (idx *locationIndex) rangeQuery(start, end time.Time) []LocationData {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	lo := sort.Search(len(idx.entries), func(i int) bool {
+		return !idx.entries[i].Timestamp.Before(start)
+	})
+	hi := sort.Search(len(idx.entries), func(i int) bool {
+		return idx.entries[i].Timestamp.After(end)
+	})
+	if lo > hi {
+		lo = hi
+	}
+
+	result := make([]LocationData, hi-lo)
+	copy(result, idx.entries[lo:hi])
+	return result
+}
+
+// stats reports the count, time bounds, and approximate stored size of the index.
+func (idx *locationIndex) stats() (count int, first, last time.Time, bytes int64) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	count = len(idx.entries)
+	if count > 0 {
+		first = idx.entries[0].Timestamp
+		last = idx.entries[count-1].Timestamp
+	}
+	bytes = idx.bytes
+	return
+}
+
+// compact rewrites the index's backing slice into a single contiguous block,
+// dropping the spare capacity left behind by repeated appends. It does not
+// sort: append already keeps entries ordered on every write. It is run
+// periodically by runIndexCompaction rather than on every write.
+func (idx *locationIndex) compact() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.loaded || len(idx.entries) == 0 {
+		return
+	}
+
+	contiguous := make([]LocationData, len(idx.entries))
+	copy(contiguous, idx.entries)
+	idx.entries = contiguous
+}
+
+// approximateBytes estimates the on-disk JSON footprint of a batch of points.
+// It avoids re-marshalling every entry on every call; a fixed per-record
+// estimate is accurate enough for the /user/{id}/stats endpoint.
+const approxBytesPerRecord = 64
+
+func approximateBytes(points []LocationData) int64 {
+	return int64(len(points)) * approxBytesPerRecord
+}
+
+// runIndexCompaction periodically compacts every loaded index, then evicts the
+// least-recently-used indexes down to maxCachedIndexes, until ctx is done.
+func runIndexCompaction(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			indexesMutex.Lock()
+			targets := make([]*locationIndex, 0, len(indexes))
+			for _, idx := range indexes {
+				targets = append(targets, idx)
+			}
+			indexesMutex.Unlock()
+
+			for _, idx := range targets {
+				idx.compact()
+			}
+
+			evictLRUIndexes()
+		}
+	}
+}
+
+// evictLRUIndexes drops cached indexes in least-recently-used order until at most
+// maxCachedIndexes remain, bounding the cache's memory footprint regardless of how
+// many distinct tenant/user pairs have ever been queried.
+func evictLRUIndexes() {
+	indexesMutex.Lock()
+	defer indexesMutex.Unlock()
+
+	if len(indexes) <= maxCachedIndexes {
+		return
+	}
+
+	type keyed struct {
+		key        indexKey
+		lastAccess time.Time
+	}
+	ordered := make([]keyed, 0, len(indexes))
+	for key, idx := range indexes {
+		idx.mu.RLock()
+		ordered = append(ordered, keyed{key: key, lastAccess: idx.lastAccess})
+		idx.mu.RUnlock()
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].lastAccess.Before(ordered[j].lastAccess)
+	})
+
+	evict := len(indexes) - maxCachedIndexes
+	for i := 0; i < evict; i++ {
+		delete(indexes, ordered[i].key)
+	}
+}
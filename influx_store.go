@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+// influxStore is a Store backend that writes points straight into an existing
+// InfluxDB v2 instance, for users who already run Influx-backed dashboards
+// and want this simulator's traffic to land there directly. Enabled via
+// -store=influxdb.
+type influxStore struct {
+	client influxdb2.Client
+	org    string
+	bucket string
+}
+
+// newInfluxStore connects to the InfluxDB v2 instance at url using token, scoped to org/bucket.
+func newInfluxStore(url, token, org, bucket string) (*influxStore, error) {
+	if url == "" || token == "" || org == "" || bucket == "" {
+		return nil, fmt.Errorf("-influx-url, -influx-token, -influx-org, and -influx-bucket are all required for -store=influxdb")
+	}
+	return &influxStore{
+		client: influxdb2.NewClient(url, token),
+		org:    org,
+		bucket: bucket,
+	}, nil
+}
+
+// WriteLocationData maps each LocationData point to a point in measurement
+// "user_location" tagged with tenant and user_id, and writes it through the
+// client's async batching writer.
+func (s *influxStore) WriteLocationData(tenant, userID string, dataPoints []LocationData) error {
+	writer := s.client.WriteAPI(s.org, s.bucket)
+	for _, data := range dataPoints {
+		point := influxdb2.NewPoint(
+			"user_location",
+			map[string]string{"tenant": tenant, "user_id": userID},
+			map[string]interface{}{"dx": data.DeltaX, "dy": data.DeltaY},
+			data.Timestamp,
+		)
+		writer.WritePoint(point)
+	}
+	return nil
+}
+
+// ReadLocationDataRange queries InfluxDB for the tenant/user's points with a timestamp
+// in [start, end], sorted oldest to newest.
+func (s *influxStore) ReadLocationDataRange(tenant, userID string, start, end time.Time) ([]LocationData, error) {
+	queryAPI := s.client.QueryAPI(s.org)
+	flux := fmt.Sprintf(`
+from(bucket: "%s")
+  |> range(start: %s, stop: %s)
+  |> filter(fn: (r) => r._measurement == "user_location" and r.tenant == "%s" and r.user_id == "%s")
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+  |> sort(columns: ["_time"])
+`, s.bucket, start.Format(time.RFC3339), end.Format(time.RFC3339), tenant, userID)
+
+	result, err := queryAPI.Query(context.Background(), flux)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query InfluxDB for user %s: %w", userID, err)
+	}
+	defer result.Close()
+
+	var points []LocationData
+	for result.Next() {
+		record := result.Record()
+		dx, _ := record.ValueByKey("dx").(float64)
+		dy, _ := record.ValueByKey("dy").(float64)
+		points = append(points, LocationData{DeltaX: dx, DeltaY: dy, Timestamp: record.Time()})
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("error iterating InfluxDB query results for user %s: %w", userID, result.Err())
+	}
+
+	return points, nil
+}
+
+// Close flushes any buffered points and closes the client connection.
+func (s *influxStore) Close() error {
+	s.client.Close()
+	return nil
+}
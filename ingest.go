@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseLineProtocol parses a single line of the form
+// "user=<id> dx=<f> dy=<f> ts=<unixnano>" into a user ID and LocationData point.
+// The ts field is optional; if omitted the current time is used.
+func parseLineProtocol(line string) (userID string, data LocationData, err error) {
+	fields := strings.Fields(line)
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return "", LocationData{}, fmt.Errorf("malformed field %q", f)
+		}
+		values[kv[0]] = kv[1]
+	}
+
+	userID = values["user"]
+	if userID == "" {
+		return "", LocationData{}, fmt.Errorf("missing required field 'user'")
+	}
+
+	dx, err := strconv.ParseFloat(values["dx"], 64)
+	if err != nil {
+		return "", LocationData{}, fmt.Errorf("invalid 'dx': %w", err)
+	}
+	dy, err := strconv.ParseFloat(values["dy"], 64)
+	if err != nil {
+		return "", LocationData{}, fmt.Errorf("invalid 'dy': %w", err)
+	}
+
+	ts := time.Now()
+	if tsStr, ok := values["ts"]; ok {
+		nanos, err := strconv.ParseInt(tsStr, 10, 64)
+		if err != nil {
+			return "", LocationData{}, fmt.Errorf("invalid 'ts': %w", err)
+		}
+		ts = time.Unix(0, nanos)
+	}
+
+	return userID, LocationData{DeltaX: dx, DeltaY: dy, Timestamp: ts}, nil
+}
+
+// handleIngest accepts POST /ingest with a line-protocol body (one point per line) and
+// writes each point via the same batching path the simulator uses.
+func handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
+		return
+	}
+
+	written, err := ingestLines(p.Tenant, r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to ingest: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Ingested %d point(s).\n", written)
+}
+
+// ingestLines parses every line-protocol point read from r, groups them by user, and
+// writes each group via WriteLocationData. It returns the number of points written.
+func ingestLines(tenant string, r io.Reader) (int, error) {
+	byUser := make(map[string][]LocationData)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		userID, data, err := parseLineProtocol(line)
+		if err != nil {
+			return 0, fmt.Errorf("parsing line %q: %w", line, err)
+		}
+		byUser[userID] = append(byUser[userID], data)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for userID, points := range byUser {
+		if err := WriteLocationData(tenant, userID, points); err != nil {
+			log.Printf("Error writing ingested data for tenant %s user %s: %v", tenant, userID, err)
+			continue
+		}
+		written += len(points)
+	}
+	return written, nil
+}
+
+// startUDPListener listens for line-protocol datagrams on addr and ingests every point
+// under tenant. Each datagram may contain one or more newline-separated points. It
+// stops listening once ctx is done.
+func startUDPListener(ctx context.Context, addr, tenant string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve UDP address %s: %w", addr, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP %s: %w", addr, err)
+	}
+
+	log.Printf("UDP ingest listener active on %s (tenant=%s)", addr, tenant)
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("UDP ingest read error: %v", err)
+				continue
+			}
+			if _, err := ingestLines(tenant, bytes.NewReader(buf[:n])); err != nil {
+				log.Printf("UDP ingest parse error: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
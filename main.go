@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	// "fmt" // Removed unused import
 	"log"
@@ -8,20 +9,36 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
+// indexCompactionInterval controls how often a user's in-memory timestamp index
+// is rewritten into a single contiguous block.
+const indexCompactionInterval = 5 * time.Minute
+
 func main() {
 	// Command-line flags
 	dbPath := flag.String("dbpath", "./user_movement_db", "Path to the unitdb database directory")
 	listenAddr := flag.String("addr", ":8080", "Address and port to listen on")
+	authTokens := flag.String("auth-tokens", "", "Comma-separated list of token:tenant:subject entries accepted as bearer API tokens")
+	udpAddr := flag.String("udp-addr", "", "If set, also listen for line-protocol ingest datagrams on this UDP address")
+	udpTenant := flag.String("udp-tenant", "", "Tenant to attribute UDP-ingested points to (required if -udp-addr is set)")
+	storeKind := flag.String("store", "unitdb", "Storage backend to use: \"unitdb\" or \"influxdb\"")
+	influxURL := flag.String("influx-url", "", "InfluxDB v2 server URL (required for -store=influxdb)")
+	influxToken := flag.String("influx-token", "", "InfluxDB v2 API token (required for -store=influxdb)")
+	influxOrg := flag.String("influx-org", "", "InfluxDB v2 organization (required for -store=influxdb)")
+	influxBucket := flag.String("influx-bucket", "", "InfluxDB v2 bucket (required for -store=influxdb)")
+	flag.BoolVar(&logQueries, "log-queries", false, "Log tenant, user, min/max, rows returned, and elapsed time for every /user read")
 	flag.Parse()
 
 	// Setup logging
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	log.Println("Starting User Movement Simulator...")
 
+	loadTokens(*authTokens)
+
 	// Initialize Database
-	if err := InitDB(*dbPath); err != nil {
+	if err := InitDB(*storeKind, *dbPath, *influxURL, *influxToken, *influxOrg, *influxBucket); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer CloseDB()
@@ -30,20 +47,38 @@ func main() {
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
 
+	backgroundCtx, cancelBackground := context.WithCancel(context.Background())
+
 	go func() {
 		<-stopChan
 		log.Println("Received shutdown signal. Stopping simulations and closing database...")
+		cancelBackground()
 		stopSimulationsInternal() // Stop any running simulations
 		CloseDB()                 // Close DB connection
 		log.Println("Shutdown complete.")
 		os.Exit(0)
 	}()
 
+	go runIndexCompaction(backgroundCtx, indexCompactionInterval)
+
+	if *udpAddr != "" {
+		if *udpTenant == "" {
+			log.Fatal("-udp-tenant is required when -udp-addr is set")
+		}
+		if err := startUDPListener(backgroundCtx, *udpAddr, *udpTenant); err != nil {
+			log.Fatalf("Failed to start UDP ingest listener: %v", err)
+		}
+	}
+
 	// Setup HTTP server
 	mux := http.NewServeMux()
-	mux.HandleFunc("/start", handleStart)
-	mux.HandleFunc("/stop", handleStop)
-	mux.HandleFunc("/user/", handleGetUser) // Register a prefix handler
+	mux.HandleFunc("/start", withMetrics("/start", withAuth(handleStart)))
+	mux.HandleFunc("/stop", withMetrics("/stop", withAuth(handleStop)))
+	mux.HandleFunc("/user/", withMetrics("/user", withAuth(handleUserRoute))) // Register a prefix handler
+	mux.HandleFunc("/ingest", withMetrics("/ingest", withAuth(handleIngest)))
+	mux.HandleFunc("/subscriptions", withMetrics("/subscriptions", withAuth(handleSubscriptions)))
+	mux.HandleFunc("/metrics", withAuth(handleMetrics))
+	mux.HandleFunc("/debug/stats", withAuth(handleDebugStats))
 
 	server := &http.Server{
 		Addr:    *listenAddr,
@@ -51,11 +86,16 @@ func main() {
 	}
 
 	log.Printf("Server listening on %s", *listenAddr)
-	log.Printf("Database stored at %s", *dbPath)
-	log.Println("Endpoints:")
-	log.Println("  POST /start   - Body: {\"user_ids\": [\"id1\", \"id2\"]}")
+	log.Printf("Storage backend: %s", *storeKind)
+	log.Println("Endpoints (all require Authorization: Bearer <token>):")
+	log.Println("  POST /start   - Body: {\"user_ids\": [...], \"model\": \"random-walk\"|\"waypoint\"|\"replay\", \"params\": {...}}")
 	log.Println("  POST /stop")
-	log.Println("  GET  /user/{user_id}")
+	log.Println("  GET  /user/{user_id}        - Query: start/end (RFC3339) or legacy min/max")
+	log.Println("  GET  /user/{user_id}/stats")
+	log.Println("  POST /ingest  - Body: line-protocol, one point per line (user=<id> dx=<f> dy=<f> ts=<unixnano>)")
+	log.Println("  POST /subscriptions - Body: {\"kind\": \"http\"|\"udp\", \"target\": \"...\"}")
+	log.Println("  GET  /metrics       - Prometheus text format")
+	log.Println("  GET  /debug/stats   - JSON, scoped to the caller's own tenant")
 
 	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("HTTP server ListenAndServe: %v", err)
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Prometheus metrics, registered at init and served at /metrics.
+var (
+	batchesWrittenTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "simulator_batches_written_total",
+		Help: "Number of location-data batches written, per tenant/user.",
+	}, []string{"tenant", "user_id"})
+
+	pointsWrittenTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "simulator_points_written_total",
+		Help: "Number of location-data points written, per tenant/user.",
+	}, []string{"tenant", "user_id"})
+
+	writeErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "simulator_write_errors_total",
+		Help: "Number of errors writing location data, per tenant/user.",
+	}, []string{"tenant", "user_id"})
+
+	batchFlushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "simulator_batch_flush_duration_seconds",
+		Help: "Duration of store batch writes.",
+	})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "simulator_http_request_duration_seconds",
+		Help: "Latency of HTTP requests, per route.",
+	}, []string{"route"})
+
+	pointsReturnedPerRead = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "simulator_points_returned_per_read",
+		Help:    "Number of points returned per /user read.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	activeSimulationsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "simulator_active_simulations",
+		Help: "Number of currently active per-user simulations.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		batchesWrittenTotal,
+		pointsWrittenTotal,
+		writeErrorsTotal,
+		batchFlushDuration,
+		requestDuration,
+		pointsReturnedPerRead,
+		activeSimulationsGauge,
+	)
+}
+
+// userStatsKey identifies the per-tenant, per-user figures tracked for /debug/stats.
+type userStatsKey struct {
+	Tenant string
+	UserID string
+}
+
+// userStats tracks per-user figures that aren't naturally Prometheus series
+// (a point in time, a current depth) for the /debug/stats endpoint.
+type userStats struct {
+	mu          sync.Mutex
+	lastWrite   time.Time
+	bufferDepth int
+}
+
+var (
+	userStatsByKey = make(map[userStatsKey]*userStats)
+	userStatsMutex sync.Mutex
+)
+
+func getUserStats(tenant, userID string) *userStats {
+	key := userStatsKey{Tenant: tenant, UserID: userID}
+
+	userStatsMutex.Lock()
+	defer userStatsMutex.Unlock()
+
+	s, ok := userStatsByKey[key]
+	if !ok {
+		s = &userStats{}
+		userStatsByKey[key] = s
+	}
+	return s
+}
+
+// recordWrite updates write-path metrics for a single batch write attempt.
+func recordWrite(tenant, userID string, points int, dur time.Duration, err error) {
+	batchFlushDuration.Observe(dur.Seconds())
+	if err != nil {
+		writeErrorsTotal.WithLabelValues(tenant, userID).Inc()
+		return
+	}
+
+	batchesWrittenTotal.WithLabelValues(tenant, userID).Inc()
+	pointsWrittenTotal.WithLabelValues(tenant, userID).Add(float64(points))
+
+	s := getUserStats(tenant, userID)
+	s.mu.Lock()
+	s.lastWrite = time.Now()
+	s.mu.Unlock()
+}
+
+// recordBufferDepth updates the in-memory write buffer depth reported for a user's simulation.
+func recordBufferDepth(tenant, userID string, depth int) {
+	s := getUserStats(tenant, userID)
+	s.mu.Lock()
+	s.bufferDepth = depth
+	s.mu.Unlock()
+}
+
+// recordRead updates read-path metrics for a completed /user read.
+func recordRead(rows int) {
+	pointsReturnedPerRead.Observe(float64(rows))
+}
+
+// updateActiveSimulationsGauge recomputes the active-simulations gauge from activeSimulations.
+// Callers must not hold activeSimulationsMutex.
+func updateActiveSimulationsGauge() {
+	activeSimulationsMutex.Lock()
+	total := 0
+	for _, tenantSimulations := range activeSimulations {
+		total += len(tenantSimulations)
+	}
+	activeSimulationsMutex.Unlock()
+
+	activeSimulationsGauge.Set(float64(total))
+}
+
+// withMetrics wraps an HTTP handler to record its latency under routeLabel in
+// simulator_http_request_duration_seconds.
+func withMetrics(routeLabel string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		requestDuration.WithLabelValues(routeLabel).Observe(time.Since(start).Seconds())
+	}
+}
+
+// handleMetrics serves GET /metrics in Prometheus text format, like
+// promhttp.Handler(), but first drops every series carrying a "tenant" label
+// other than the caller's own. Without this, any valid bearer token could read
+// simulator_batches_written_total/simulator_points_written_total/etc for every
+// other tenant straight off the registry, the same cross-tenant leak /debug/stats
+// is scoped against.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
+		return
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to gather metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, mf := range families {
+		filtered := filterMetricFamilyByTenant(mf, p.Tenant)
+		if len(filtered.Metric) == 0 {
+			continue
+		}
+		if err := enc.Encode(filtered); err != nil {
+			log.Printf("Error encoding metric family %s: %v", mf.GetName(), err)
+			return
+		}
+	}
+}
+
+// filterMetricFamilyByTenant returns a copy of mf containing only the metrics that
+// either carry no "tenant" label (global, not per-tenant) or carry tenant == tenant.
+func filterMetricFamilyByTenant(mf *dto.MetricFamily, tenant string) *dto.MetricFamily {
+	kept := make([]*dto.Metric, 0, len(mf.Metric))
+	for _, m := range mf.Metric {
+		labeledTenant, hasTenantLabel := "", false
+		for _, l := range m.Label {
+			if l.GetName() == "tenant" {
+				labeledTenant, hasTenantLabel = l.GetValue(), true
+				break
+			}
+		}
+		if !hasTenantLabel || labeledTenant == tenant {
+			kept = append(kept, m)
+		}
+	}
+	out := *mf
+	out.Metric = kept
+	return &out
+}
+
+// DebugUserStats is a single user's entry in the /debug/stats response.
+type DebugUserStats struct {
+	Tenant      string    `json:"tenant"`
+	UserID      string    `json:"user_id"`
+	LastWrite   time.Time `json:"last_write,omitempty"`
+	BufferDepth int       `json:"buffer_depth"`
+}
+
+// DebugStatsResponse is the JSON body returned by GET /debug/stats.
+type DebugStatsResponse struct {
+	ActiveSimulations int              `json:"active_simulations"`
+	Users             []DebugUserStats `json:"users"`
+}
+
+// handleDebugStats serves GET /debug/stats as JSON: the number of active simulations,
+// plus each user's last-write timestamp and current write-buffer depth. The write,
+// error, latency and read counters and histograms exposed at /metrics are not
+// included. Like
+// every other endpoint, results are scoped to the caller's own tenant so one
+// tenant's token can't be used to enumerate another's user IDs or activity.
+func handleDebugStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
+		return
+	}
+
+	userStatsMutex.Lock()
+	users := make([]DebugUserStats, 0)
+	for key, s := range userStatsByKey {
+		if key.Tenant != p.Tenant {
+			continue
+		}
+		s.mu.Lock()
+		users = append(users, DebugUserStats{
+			Tenant:      key.Tenant,
+			UserID:      key.UserID,
+			LastWrite:   s.lastWrite,
+			BufferDepth: s.bufferDepth,
+		})
+		s.mu.Unlock()
+	}
+	userStatsMutex.Unlock()
+
+	activeSimulationsMutex.Lock()
+	active := len(activeSimulations[p.Tenant])
+	activeSimulationsMutex.Unlock()
+
+	response := DebugStatsResponse{
+		ActiveSimulations: active,
+		Users:             users,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
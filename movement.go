@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MovementModel produces successive (dx, dy) displacements for a simulated user.
+// ok is false once the model has nothing more to emit (e.g. a waypoint model that
+// has reached its last target); models that run indefinitely always return true.
+type MovementModel interface {
+	Step(rng *rand.Rand, dt time.Duration) (dx, dy float64, ok bool)
+}
+
+// pacedModel is implemented by movement models whose most recent Step result should
+// only be emitted after a specific delay, rather than back-to-back at the ambient
+// simulation-loop cadence. The simulator checks for this via a type assertion and
+// waits on nextDelay itself (interruptibly, alongside ctx.Done()) so that pacing
+// can't block /stop or the simulation timeout from taking effect.
+type pacedModel interface {
+	MovementModel
+	nextDelay() time.Duration
+}
+
+// newMovementModel constructs the MovementModel named by model, configured by the
+// raw JSON params from a StartRequest. An empty model name selects the default
+// correlated random walk.
+func newMovementModel(model string, params json.RawMessage) (MovementModel, error) {
+	switch model {
+	case "", "random-walk":
+		return newCorrelatedRandomWalk(params)
+	case "waypoint":
+		return newWaypointModel(params)
+	case "replay":
+		return newReplayModel(params)
+	default:
+		return nil, fmt.Errorf("unknown movement model %q", model)
+	}
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// correlatedRandomWalkParams configures a correlatedRandomWalk.
+type correlatedRandomWalkParams struct {
+	Sigma  float64 `json:"sigma"`  // heading persistence: std dev of angle change per step, radians
+	Mu     float64 `json:"mu"`     // mean step magnitude
+	Stddev float64 `json:"stddev"` // std dev of step magnitude
+}
+
+// correlatedRandomWalk keeps the previous heading and perturbs it each step, rather
+// than picking an independent random angle every tick, so trajectories drift
+// smoothly instead of jittering in place.
+type correlatedRandomWalk struct {
+	params   correlatedRandomWalkParams
+	theta    float64
+	hasTheta bool
+}
+
+func newCorrelatedRandomWalk(raw json.RawMessage) (*correlatedRandomWalk, error) {
+	params := correlatedRandomWalkParams{
+		Sigma:  0.3,
+		Mu:     maxDistancePerStep / 2,
+		Stddev: maxDistancePerStep / 4,
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, fmt.Errorf("invalid random-walk params: %w", err)
+		}
+	}
+	return &correlatedRandomWalk{params: params}, nil
+}
+
+func (m *correlatedRandomWalk) Step(rng *rand.Rand, dt time.Duration) (float64, float64, bool) {
+	if !m.hasTheta {
+		m.theta = rng.Float64() * 2 * math.Pi
+		m.hasTheta = true
+	} else {
+		m.theta += rng.NormFloat64() * m.params.Sigma
+	}
+
+	magnitude := clamp(rng.NormFloat64()*m.params.Stddev+m.params.Mu, 0, maxDistancePerStep)
+
+	dx := magnitude * math.Cos(m.theta)
+	dy := magnitude * math.Sin(m.theta)
+	return dx, dy, true
+}
+
+// waypoint is a single target in a waypointModel's route.
+type waypoint struct {
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	DwellMillis int     `json:"dwell_ms,omitempty"`
+}
+
+// waypointParams configures a waypointModel.
+type waypointParams struct {
+	Waypoints []waypoint `json:"waypoints"`
+	Speed     float64    `json:"speed"` // distance units per second
+}
+
+// waypointModel walks a straight line toward the current target at a fixed
+// speed, advancing to the next target (after an optional dwell) on arrival.
+// It reports ok=false once it has arrived at its last waypoint.
+type waypointModel struct {
+	params         waypointParams
+	x, y           float64
+	index          int
+	dwellRemaining time.Duration
+}
+
+func newWaypointModel(raw json.RawMessage) (*waypointModel, error) {
+	var params waypointParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, fmt.Errorf("invalid waypoint params: %w", err)
+	}
+	if len(params.Waypoints) == 0 {
+		return nil, fmt.Errorf("waypoint model requires at least one waypoint")
+	}
+	if params.Speed <= 0 {
+		return nil, fmt.Errorf("waypoint model requires a positive speed")
+	}
+	return &waypointModel{params: params}, nil
+}
+
+func (m *waypointModel) Step(rng *rand.Rand, dt time.Duration) (float64, float64, bool) {
+	if m.index >= len(m.params.Waypoints) {
+		return 0, 0, false
+	}
+
+	if m.dwellRemaining > 0 {
+		m.dwellRemaining -= dt
+		return 0, 0, true
+	}
+
+	target := m.params.Waypoints[m.index]
+	toTargetX := target.X - m.x
+	toTargetY := target.Y - m.y
+	dist := math.Hypot(toTargetX, toTargetY)
+
+	if dist == 0 {
+		m.arrive(target)
+		return 0, 0, true
+	}
+
+	step := math.Min(m.params.Speed*dt.Seconds(), dist)
+	ratio := step / dist
+	dx := toTargetX * ratio
+	dy := toTargetY * ratio
+	m.x += dx
+	m.y += dy
+
+	if step >= dist {
+		m.arrive(target)
+	}
+
+	return dx, dy, true
+}
+
+func (m *waypointModel) arrive(target waypoint) {
+	m.index++
+	if target.DwellMillis > 0 {
+		m.dwellRemaining = time.Duration(target.DwellMillis) * time.Millisecond
+	}
+}
+
+// replayPoint is a single recorded displacement in a replayModel's route.
+type replayPoint struct {
+	DX float64       `json:"dx"`
+	DY float64       `json:"dy"`
+	DT time.Duration `json:"dt"` // nanoseconds to wait after this point before the next one is emitted
+}
+
+// replayParams configures a replayModel.
+type replayParams struct {
+	Path string `json:"path"` // CSV or JSON file of (dx, dy, dt) records
+}
+
+// replayModel emits a prerecorded sequence of displacements in an endless loop.
+// It implements pacedModel so the simulator paces emission against each point's
+// recorded dt rather than the ambient simulation-loop cadence.
+type replayModel struct {
+	points []replayPoint
+	index  int
+	delay  time.Duration // dt recorded for the point most recently returned by Step
+}
+
+func newReplayModel(raw json.RawMessage) (*replayModel, error) {
+	var params replayParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, fmt.Errorf("invalid replay params: %w", err)
+	}
+	if params.Path == "" {
+		return nil, fmt.Errorf("replay model requires a 'path'")
+	}
+
+	points, err := loadReplayPoints(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("replay file %s contains no points", params.Path)
+	}
+
+	return &replayModel{points: points}, nil
+}
+
+func loadReplayPoints(path string) ([]replayPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(path, ".json") {
+		var points []replayPoint
+		if err := json.NewDecoder(f).Decode(&points); err != nil {
+			return nil, fmt.Errorf("failed to parse replay JSON %s: %w", path, err)
+		}
+		return points, nil
+	}
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse replay CSV %s: %w", path, err)
+	}
+
+	points := make([]replayPoint, 0, len(records))
+	for _, rec := range records {
+		if len(rec) != 3 {
+			return nil, fmt.Errorf("malformed replay CSV row %v: expected dx,dy,dt", rec)
+		}
+		dx, err := strconv.ParseFloat(rec[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dx in replay CSV: %w", err)
+		}
+		dy, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dy in replay CSV: %w", err)
+		}
+		dtNanos, err := strconv.ParseInt(rec[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dt in replay CSV: %w", err)
+		}
+		points = append(points, replayPoint{DX: dx, DY: dy, DT: time.Duration(dtNanos)})
+	}
+	return points, nil
+}
+
+func (m *replayModel) Step(rng *rand.Rand, dt time.Duration) (float64, float64, bool) {
+	point := m.points[m.index%len(m.points)]
+	m.index++
+	m.delay = point.DT
+	return point.DX, point.DY, true
+}
+
+// nextDelay returns how long the simulator should wait before calling Step again,
+// so the recorded inter-sample timing is honored instead of discarded.
+func (m *replayModel) nextDelay() time.Duration {
+	return m.delay
+}
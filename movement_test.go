@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestCorrelatedRandomWalkAngleDelta(t *testing.T) {
+	const sigma = 0.25
+	params := correlatedRandomWalkParams{Sigma: sigma, Mu: maxDistancePerStep / 2, Stddev: maxDistancePerStep / 4}
+	model := &correlatedRandomWalk{params: params}
+
+	rng := rand.New(rand.NewSource(1))
+	const steps = 5000
+
+	prevTheta := 0.0
+	deltas := make([]float64, 0, steps)
+	for i := 0; i < steps; i++ {
+		dx, dy, ok := model.Step(rng, 100*time.Millisecond)
+		if !ok {
+			t.Fatalf("random walk should never terminate, got ok=false at step %d", i)
+		}
+		theta := math.Atan2(dy, dx)
+		if i > 0 {
+			delta := angleDiff(theta, prevTheta)
+			deltas = append(deltas, delta)
+		}
+		prevTheta = theta
+	}
+
+	mean := 0.0
+	for _, d := range deltas {
+		mean += d
+	}
+	mean /= float64(len(deltas))
+
+	variance := 0.0
+	for _, d := range deltas {
+		variance += (d - mean) * (d - mean)
+	}
+	variance /= float64(len(deltas))
+	stddev := math.Sqrt(variance)
+
+	// The empirical step-to-step angle delta should track the configured sigma
+	// reasonably closely; allow generous slack since magnitude is also random.
+	if stddev < sigma*0.5 || stddev > sigma*1.5 {
+		t.Errorf("angle delta stddev = %.3f, want within [%.3f, %.3f] of sigma=%.3f", stddev, sigma*0.5, sigma*1.5, sigma)
+	}
+}
+
+// angleDiff returns the signed difference between two angles, wrapped to (-pi, pi].
+func angleDiff(a, b float64) float64 {
+	d := a - b
+	for d > math.Pi {
+		d -= 2 * math.Pi
+	}
+	for d < -math.Pi {
+		d += 2 * math.Pi
+	}
+	return d
+}
+
+func TestWaypointModelTerminatesAtLastPoint(t *testing.T) {
+	params := waypointParams{
+		Waypoints: []waypoint{
+			{X: 1, Y: 0},
+			{X: 1, Y: 1},
+		},
+		Speed: 10, // large relative to distances, so each step reaches its target
+	}
+	model := &waypointModel{params: params}
+	rng := rand.New(rand.NewSource(1))
+
+	var ok bool
+	for i := 0; i < 100; i++ {
+		_, _, ok = model.Step(rng, 100*time.Millisecond)
+		if !ok {
+			break
+		}
+	}
+
+	if ok {
+		t.Fatalf("waypoint model did not terminate within 100 steps")
+	}
+	if model.x != 1 || model.y != 1 {
+		t.Errorf("waypoint model ended at (%.2f, %.2f), want (1, 1)", model.x, model.y)
+	}
+}
+
+func TestReplayModelReportsRecordedDTAsDelay(t *testing.T) {
+	const recordedDT = 20 * time.Millisecond
+	model := &replayModel{points: []replayPoint{{DX: 1, DY: 2, DT: recordedDT}}}
+	rng := rand.New(rand.NewSource(1))
+
+	dx, dy, ok := model.Step(rng, 0)
+
+	if !ok {
+		t.Fatalf("replay model should never terminate, got ok=false")
+	}
+	if dx != 1 || dy != 2 {
+		t.Errorf("Step() = (%.2f, %.2f), want (1, 2)", dx, dy)
+	}
+	// Step itself must not block: pacing is the simulator's job (via the pacedModel
+	// interface), so that /stop and the simulation timeout can interrupt it.
+	if model.nextDelay() != recordedDT {
+		t.Errorf("nextDelay() = %s, want the recorded dt of %s", model.nextDelay(), recordedDT)
+	}
+
+	var _ pacedModel = model
+}
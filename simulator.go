@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log"
-	"math"
 	"math/rand"
 	"time"
 )
@@ -16,12 +16,19 @@ const (
 	flushInterval = 100 * time.Millisecond // Max time between flushes even if batch isn't full
 )
 
-// SimulateUserMovement runs the location simulation for a single user.
-// It generates random movement data and writes it to the database in batches.
-// It stops when the provided context is cancelled.
-func SimulateUserMovement(ctx context.Context, userID string) {
-	log.Printf("Starting simulation for user %s", userID)
-	defer log.Printf("Stopping simulation for user %s", userID)
+// SimulateUserMovement runs the location simulation for a single user within a tenant,
+// using the given movement model (and its raw JSON params) to generate successive
+// displacements. It writes generated data to the database in batches, and stops
+// when the provided context is cancelled or the model has nothing left to emit.
+func SimulateUserMovement(ctx context.Context, tenant, userID, modelName string, modelParams json.RawMessage) {
+	log.Printf("Starting simulation for tenant %s user %s (model=%s)", tenant, userID, modelName)
+	defer log.Printf("Stopping simulation for tenant %s user %s", tenant, userID)
+
+	model, err := newMovementModel(modelName, modelParams)
+	if err != nil {
+		log.Printf("Error starting simulation for tenant %s user %s: %v", tenant, userID, err)
+		return
+	}
 
 	// Seed random number generator for this goroutine
 	source := rand.NewSource(time.Now().UnixNano())
@@ -31,56 +38,63 @@ func SimulateUserMovement(ctx context.Context, userID string) {
 	flushTicker := time.NewTicker(flushInterval)
 	defer flushTicker.Stop()
 
+	flush := func() {
+		if len(dataBuffer) > 0 {
+			if err := WriteLocationData(tenant, userID, dataBuffer); err != nil {
+				log.Printf("Error flushing data for tenant %s user %s: %v", tenant, userID, err)
+			}
+			dataBuffer = make([]LocationData, 0, batchSize)
+			recordBufferDepth(tenant, userID, 0)
+		}
+	}
+
+	lastStep := time.Now()
 	for {
 		select {
 		case <-ctx.Done(): // Check if context has been cancelled (by /stop or timeout)
-			if len(dataBuffer) > 0 {
-				if err := WriteLocationData(userID, dataBuffer); err != nil {
-					log.Printf("Error flushing final data for user %s: %v", userID, err)
-				}
-			}
+			flush()
 			return
 		case <-flushTicker.C:
-			// Flush buffer periodically
-			if len(dataBuffer) > 0 {
-				if err := WriteLocationData(userID, dataBuffer); err != nil {
-					log.Printf("Error flushing data buffer for user %s: %v", userID, err)
-				}
-				dataBuffer = make([]LocationData, 0, batchSize) // Reset buffer
-			}
+			flush()
 		default:
 			// Generate next data point
-			timestamp := time.Now()
-			deltaX, deltaY := generateMovement(rng)
+			now := time.Now()
+			dt := now.Sub(lastStep)
+			lastStep = now
 
-			dataPoint := LocationData{
-				DeltaX:    deltaX,
-				DeltaY:    deltaY,
-				Timestamp: timestamp,
+			deltaX, deltaY, ok := model.Step(rng, dt)
+			if !ok {
+				flush()
+				deregisterSimulation(tenant, userID)
+				return
 			}
 
-			dataBuffer = append(dataBuffer, dataPoint)
+			dataBuffer = append(dataBuffer, LocationData{
+				DeltaX:    deltaX,
+				DeltaY:    deltaY,
+				Timestamp: now,
+			})
+			recordBufferDepth(tenant, userID, len(dataBuffer))
 
 			// Write to DB if batch is full
 			if len(dataBuffer) >= batchSize {
-				if err := WriteLocationData(userID, dataBuffer); err != nil {
-					// Log error and continue. Data might be lost for this batch.
-					log.Printf("Error writing batch data for user %s: %v", userID, err)
+				flush()
+				flushTicker.Reset(flushInterval) // Reset ticker after a full batch write
+			}
+
+			// Models like replay report a specific pacing delay for the point just
+			// stepped; wait it out here, interruptibly, so pacing can never block
+			// /stop or the simulation timeout from taking effect.
+			if pm, ok := model.(pacedModel); ok {
+				if delay := pm.nextDelay(); delay > 0 {
+					select {
+					case <-ctx.Done():
+						flush()
+						return
+					case <-time.After(delay):
+					}
 				}
-				dataBuffer = make([]LocationData, 0, batchSize) // Reset buffer
-				flushTicker.Reset(flushInterval)                // Reset ticker after a full batch write
 			}
 		}
 	}
 }
-
-// generateMovement creates a small random displacement (dx, dy).
-func generateMovement(rng *rand.Rand) (float64, float64) {
-	angle := rng.Float64() * 2 * math.Pi
-	magnitude := rng.Float64() * maxDistancePerStep
-
-	dx := magnitude * math.Cos(angle)
-	dy := magnitude * math.Sin(angle)
-
-	return dx, dy
-}
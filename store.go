@@ -0,0 +1,16 @@
+package main
+
+import "time"
+
+// Store is the persistence backend for location data. unitdb is the default,
+// embedded implementation; InfluxDB v2 is available behind -store=influxdb
+// for users who want this simulator's traffic to land directly in an
+// existing Influx-backed dashboard.
+type Store interface {
+	WriteLocationData(tenant, userID string, dataPoints []LocationData) error
+	ReadLocationDataRange(tenant, userID string, start, end time.Time) ([]LocationData, error)
+	Close() error
+}
+
+// activeStore is the backend selected at startup via -store.
+var activeStore Store
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// sinkKind identifies the transport a subscription delivers batches over.
+type sinkKind string
+
+const (
+	sinkHTTP sinkKind = "http"
+	sinkUDP  sinkKind = "udp"
+)
+
+// subscription is a registered fan-out destination for a tenant's written batches.
+type subscription struct {
+	ID     string   `json:"id"`
+	Tenant string   `json:"-"`
+	Kind   sinkKind `json:"kind"`
+	Target string   `json:"target"`
+
+	// resolvedIP is the address validateSinkTarget resolved and allow-listed for
+	// Target at registration time. Delivery dials resolvedIP directly instead of
+	// re-resolving Target's hostname, so a subscriber can't pass validation and
+	// then repoint DNS at a disallowed address (DNS rebinding).
+	resolvedIP net.IP
+	// httpClient is set only for sinkHTTP subscriptions; it pins resolvedIP at the
+	// transport layer while leaving Target's hostname as the Host header/SNI.
+	httpClient *http.Client
+}
+
+// subscriptionBatch is the payload mirrored to every matching sink whenever
+// WriteLocationData writes a batch.
+type subscriptionBatch struct {
+	Tenant string         `json:"tenant"`
+	UserID string         `json:"user_id"`
+	Data   []LocationData `json:"data"`
+}
+
+// SubscriptionRequest is the expected JSON body for POST /subscriptions.
+type SubscriptionRequest struct {
+	Kind   string `json:"kind"` // "http" or "udp"
+	Target string `json:"target"`
+}
+
+var (
+	subscriptions      = make(map[string]*subscription)
+	subscriptionsMutex sync.RWMutex
+	nextSubscriptionID int
+)
+
+// handleSubscriptions registers a new fan-out sink for the caller's tenant.
+func handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing authenticated principal", http.StatusUnauthorized)
+		return
+	}
+
+	var req SubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	kind := sinkKind(req.Kind)
+	if kind != sinkHTTP && kind != sinkUDP {
+		http.Error(w, "'kind' must be \"http\" or \"udp\"", http.StatusBadRequest)
+		return
+	}
+	if req.Target == "" {
+		http.Error(w, "'target' cannot be empty", http.StatusBadRequest)
+		return
+	}
+	resolvedIP, err := validateSinkTarget(kind, req.Target)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'target': %v", err), http.StatusBadRequest)
+		return
+	}
+
+	subscriptionsMutex.Lock()
+	nextSubscriptionID++
+	sub := &subscription{
+		ID:         strconv.Itoa(nextSubscriptionID),
+		Tenant:     p.Tenant,
+		Kind:       kind,
+		Target:     req.Target,
+		resolvedIP: resolvedIP,
+	}
+	if kind == sinkHTTP {
+		sub.httpClient = pinnedHTTPClient(resolvedIP)
+	}
+	subscriptions[sub.ID] = sub
+	subscriptionsMutex.Unlock()
+
+	log.Printf("Registered %s subscription %s -> %s for tenant %s", kind, sub.ID, req.Target, p.Tenant)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// validateSinkTarget rejects subscription targets that would make the server itself
+// deliver data to loopback, link-local, or other private-range addresses (including
+// cloud metadata endpoints, which live in the link-local range). Without this, any
+// authenticated tenant could register a subscription to probe or reach internal-only
+// services through the simulator — a blind SSRF. It returns the first allowed
+// resolved IP, which the caller pins for delivery (see deliverToSink) rather than
+// re-resolving target's hostname on every delivery, since the latter would let a
+// subscriber pass validation and then repoint DNS at a disallowed address.
+func validateSinkTarget(kind sinkKind, target string) (net.IP, error) {
+	var host string
+	switch kind {
+	case sinkHTTP:
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target URL: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("target scheme must be \"http\" or \"https\"")
+		}
+		host = u.Hostname()
+	case sinkUDP:
+		h, _, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, fmt.Errorf("target must be host:port: %w", err)
+		}
+		host = h
+	}
+	if host == "" {
+		return nil, fmt.Errorf("target has no host")
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target host %q: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("target host %q did not resolve to any address", host)
+	}
+	for _, ip := range ips {
+		if isDisallowedSinkAddress(ip) {
+			return nil, fmt.Errorf("target host %q resolves to a disallowed address (%s)", host, ip)
+		}
+	}
+	return ips[0], nil
+}
+
+// pinnedHTTPClient returns an http.Client whose connections always dial ip, no
+// matter what host the request URL names — this is what lets subscription
+// delivery keep using the original target URL (for the Host header and TLS SNI)
+// while guaranteeing the TCP connection only ever reaches the IP validateSinkTarget
+// allow-listed at registration time.
+func pinnedHTTPClient(ip net.IP) *http.Client {
+	dialer := &net.Dialer{}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				_, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			},
+		},
+	}
+}
+
+// isDisallowedSinkAddress reports whether ip is loopback, link-local (which covers
+// the 169.254.169.254 cloud metadata endpoint), private-range, or unspecified.
+func isDisallowedSinkAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// fanOutBatch mirrors a freshly written batch to every subscription registered for tenant.
+func fanOutBatch(tenant, userID string, dataPoints []LocationData) {
+	subscriptionsMutex.RLock()
+	var matching []*subscription
+	for _, sub := range subscriptions {
+		if sub.Tenant == tenant {
+			matching = append(matching, sub)
+		}
+	}
+	subscriptionsMutex.RUnlock()
+
+	if len(matching) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(subscriptionBatch{Tenant: tenant, UserID: userID, Data: dataPoints})
+	if err != nil {
+		log.Printf("Error marshalling subscription batch for tenant %s user %s: %v", tenant, userID, err)
+		return
+	}
+
+	for _, sub := range matching {
+		go deliverToSink(sub, payload)
+	}
+}
+
+// deliverToSink sends payload to a single subscription's sink, best-effort. Both
+// kinds dial sub.resolvedIP, pinned at registration time, rather than re-resolving
+// sub.Target's hostname (see validateSinkTarget).
+func deliverToSink(sub *subscription, payload []byte) {
+	switch sub.Kind {
+	case sinkHTTP:
+		resp, err := sub.httpClient.Post(sub.Target, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			log.Printf("Error delivering batch to subscription %s (%s): %v", sub.ID, sub.Target, err)
+			return
+		}
+		resp.Body.Close()
+	case sinkUDP:
+		_, port, err := net.SplitHostPort(sub.Target)
+		if err != nil {
+			log.Printf("Error parsing UDP subscription %s (%s): %v", sub.ID, sub.Target, err)
+			return
+		}
+		conn, err := net.Dial("udp", net.JoinHostPort(sub.resolvedIP.String(), port))
+		if err != nil {
+			log.Printf("Error dialing UDP subscription %s (%s): %v", sub.ID, sub.Target, err)
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Write(payload); err != nil {
+			log.Printf("Error writing to UDP subscription %s (%s): %v", sub.ID, sub.Target, err)
+		}
+	}
+}
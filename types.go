@@ -1,6 +1,9 @@
 package main
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // TODO: Define shared data structures
 
@@ -15,6 +18,11 @@ type LocationData struct {
 // StartRequest is the expected JSON body for the /start endpoint.
 type StartRequest struct {
 	UserIDs []string `json:"user_ids"`
+	// Model selects the movement model used to generate location data: one of
+	// "random-walk" (the default), "waypoint", or "replay". Params is decoded
+	// by the selected model; see movement.go for each model's shape.
+	Model  string          `json:"model,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
 }
 
 // UserDataResponse is the structure for returning data for a user.
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/unit-io/unitdb"
+)
+
+// unitdbStore is the default Store backend, backed by the embedded unitdb database.
+type unitdbStore struct {
+	db *unitdb.DB
+}
+
+// newUnitdbStore opens a unitdb database at dbPath.
+func newUnitdbStore(dbPath string) (*unitdbStore, error) {
+	// Open DB with Mutable flag to allow potential future delete operations if needed,
+	// though the current spec doesn't require deletes.
+	db, err := unitdb.Open(dbPath, unitdb.WithDefaultOptions(), unitdb.WithMutable())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	log.Println("Database opened successfully at", dbPath)
+	return &unitdbStore{db: db}, nil
+}
+
+// GetTopicForUser formats the unitdb topic string for a given tenant and user ID.
+func GetTopicForUser(tenant, userID string) []byte {
+	return []byte(fmt.Sprintf("tenant.%s.user.%s.location", tenant, userID))
+}
+
+// WriteLocationData writes a batch of location data points for a specific tenant/user.
+func (s *unitdbStore) WriteLocationData(tenant, userID string, dataPoints []LocationData) error {
+	topic := GetTopicForUser(tenant, userID)
+
+	return s.db.Batch(func(b *unitdb.Batch, completed <-chan struct{}) error {
+		entry := unitdb.NewEntry(topic, nil)
+		for _, data := range dataPoints {
+			payload, err := json.Marshal(data)
+			if err != nil {
+				log.Printf("Error marshalling location data for user %s: %v", userID, err)
+				continue
+			}
+			// Using WithPayload reuses the parsed topic, improving efficiency
+			entry.WithPayload(payload)
+			if err := b.PutEntry(entry); err != nil {
+				log.Printf("Error putting entry in batch for user %s: %v", userID, err)
+			}
+		}
+		return nil // Signal batch completion attempt
+	})
+}
+
+// ReadLocationDataRange retrieves every point for tenant/userID with a timestamp in
+// [start, end], sorted oldest to newest.
+func (s *unitdbStore) ReadLocationDataRange(tenant, userID string, start, end time.Time) ([]LocationData, error) {
+	topic := GetTopicForUser(tenant, userID)
+	query := unitdb.NewQuery(topic)
+
+	rawMessages, err := s.db.Get(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data for user %s from DB: %w", userID, err)
+	}
+
+	locationDataList := make([]LocationData, 0, len(rawMessages))
+	for _, rawMsg := range rawMessages {
+		var data LocationData
+		if err := json.Unmarshal(rawMsg, &data); err != nil {
+			log.Printf("Error unmarshalling data for user %s: %v. Data: %s", userID, err, string(rawMsg))
+			continue // Skip corrupted data
+		}
+		if data.Timestamp.Before(start) || data.Timestamp.After(end) {
+			continue
+		}
+		locationDataList = append(locationDataList, data)
+	}
+
+	sort.Slice(locationDataList, func(i, j int) bool {
+		return locationDataList[i].Timestamp.Before(locationDataList[j].Timestamp)
+	})
+
+	return locationDataList, nil
+}
+
+// Close closes the unitdb connection.
+func (s *unitdbStore) Close() error {
+	s.db.Close()
+	log.Println("Database closed.")
+	return nil
+}